@@ -11,6 +11,9 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const airbrakeNoticeURL = `http://airbrake.io/api/v3/projects/%s/notices?key=%s`
@@ -19,10 +22,37 @@ const airbrakeNoticeURL = `http://airbrake.io/api/v3/projects/%s/notices?key=%s`
 // and provides a set of methods that can be called to send data to the airbrake services.
 type Brake struct {
 	config    *Config
-	context   *context
+	context   *noticeContext
 	projectID string
 	apiKey    string
 	noticeURL string
+
+	// NoticesDropped counts notices discarded because the async queue was full,
+	// or because they were dispatched after Close. Only incremented when
+	// Config.Async is true.
+	NoticesDropped uint64
+
+	// NoticesSent counts notices successfully posted to the airbrake API.
+	NoticesSent uint64
+
+	// NoticesRateLimited counts notices rejected (or pre-emptively dropped)
+	// because of rate limiting.
+	NoticesRateLimited uint64
+
+	rateLimitedUntilNano int64
+	unauthorized         int32
+
+	noticeCh  chan *Notice
+	workersWG sync.WaitGroup
+	pending   sync.WaitGroup
+	closeMu   sync.RWMutex
+	closed    bool
+
+	filtersMu sync.RWMutex
+	filters   []Filter
+
+	codeHunks *codeHunkCache
+	dedupe    *dedupeCache
 }
 
 // Config can be used to set optional preferences and log values
@@ -33,6 +63,13 @@ type Config struct {
 	// AppURL, when set, will be sent along with every error notice
 	AppURL string
 
+	// NoticeURL, when set, overrides the full Airbrake v3 notice endpoint a
+	// Brake posts to instead of the default airbrake.io endpoint built
+	// from the project id and api key. Useful for self-hosted/
+	// Errbit-compatible servers, or for pointing a Brake at a test server
+	// in tests.
+	NoticeURL string
+
 	// User details (for single-user applications)
 	// You can change these later-on via SetUserDetails(..)
 	UserID    string
@@ -58,6 +95,53 @@ type Config struct {
 	// When this fails, url is not shortened and original url is used.
 	// Aitbat url is calculated client-side and does not require an extra API call
 	URLService string
+
+	// Async, when true, makes Notify/Notifyf/NotifyData/Recover enqueue notices
+	// onto a buffered channel instead of sending them synchronously. A pool of
+	// worker goroutines drains the channel in the background.
+	Async bool
+
+	// QueueSize sets the capacity of the async notice queue.
+	// Only used when Async is true. Defaults to DefaultQueueSize.
+	QueueSize int
+
+	// Workers sets the number of goroutines draining the async notice queue.
+	// Only used when Async is true. Defaults to DefaultWorkers.
+	Workers int
+
+	// CodeHunkLines sets how many lines of source are captured before and
+	// after each backtrace frame's line. Zero uses DefaultCodeHunkLines;
+	// a negative value disables code hunk capture entirely.
+	CodeHunkLines int
+
+	// CodeHunkMaxFiles bounds how many distinct source files are kept in the
+	// code hunk LRU cache. Zero uses DefaultCodeHunkMaxFiles.
+	CodeHunkMaxFiles int
+
+	// CodeHunkCacheSize is the largest source file, in bytes, that will be
+	// read for code hunk capture. Frames in larger files are skipped. Zero
+	// uses DefaultCodeHunkCacheSize.
+	CodeHunkCacheSize int64
+
+	// MinSeverity, when set, drops notices below this Severity before they
+	// are sent. Notify/Notifyf/NotifyData/Recover notices carry
+	// SeverityError.
+	MinSeverity Severity
+
+	// DedupeWindow, when non-zero, deduplicates repeated notices that share
+	// a backtrace fingerprint: only the first occurrence within the window
+	// is sent, and later duplicates are counted rather than sent
+	// individually. See NotifyWithSeverity and Brake.Stats.
+	DedupeWindow time.Duration
+
+	// MaxGoroutines bounds how many other goroutines' stacks are attached to
+	// a recovered panic's notice. Zero uses DefaultMaxGoroutines.
+	MaxGoroutines int
+
+	// MaxGoroutineFrames bounds how many backtrace frames are kept per other
+	// goroutine attached to a recovered panic's notice. Zero uses
+	// DefaultMaxGoroutineFrames.
+	MaxGoroutineFrames int
 }
 
 const (
@@ -114,9 +198,14 @@ func NewBrake(projectID string, key string, environment string, config *Config)
 
 	pwd, _ := os.Getwd()
 
+	noticeURL := config.NoticeURL
+	if noticeURL == "" {
+		noticeURL = fmt.Sprintf(airbrakeNoticeURL, projectID, key)
+	}
+
 	b := &Brake{
 		config: config,
-		context: &context{
+		context: &noticeContext{
 			OS:            runtime.GOOS + "_" + runtime.GOARCH,
 			Language:      runtime.Version(),
 			RootDirectory: pwd,
@@ -131,7 +220,23 @@ func NewBrake(projectID string, key string, environment string, config *Config)
 		},
 		projectID: projectID,
 		apiKey:    key,
-		noticeURL: fmt.Sprintf(airbrakeNoticeURL, projectID, key),
+		noticeURL: noticeURL,
+	}
+
+	if config.CodeHunkLines >= 0 {
+		maxFiles := config.CodeHunkMaxFiles
+		if maxFiles <= 0 {
+			maxFiles = DefaultCodeHunkMaxFiles
+		}
+		b.codeHunks = newCodeHunkCache(maxFiles)
+	}
+
+	if config.DedupeWindow > 0 {
+		b.dedupe = newDedupeCache(DefaultDedupeCacheSize)
+	}
+
+	if config.Async {
+		b.startWorkers()
 	}
 
 	return b
@@ -145,6 +250,37 @@ func (b *Brake) SetUserDetails(id, name, email string) {
 	b.context.UserEmail = email
 }
 
+// AddFilter registers a Filter that every notice passes through before it is
+// sent to airbrake. Filters run in the order they were added. A filter that
+// returns nil causes the notice to be dropped without being sent, which is
+// useful for scrubbing sensitive data or ignoring certain errors entirely.
+// AddFilter is safe to call concurrently with Notify/Notifyf/NotifyData/
+// Recover and with other AddFilter calls.
+func (b *Brake) AddFilter(filter Filter) {
+	b.filtersMu.Lock()
+	defer b.filtersMu.Unlock()
+	b.filters = append(b.filters, filter)
+}
+
+// Reset clears any sticky rate-limit or unauthorized state recorded from a
+// previous 429/401/403 response, allowing notices to be posted again.
+func (b *Brake) Reset() {
+	atomic.StoreInt32(&b.unauthorized, 0)
+	atomic.StoreInt64(&b.rateLimitedUntilNano, 0)
+}
+
+func (b *Brake) rateLimitedUntil() time.Time {
+	ns := atomic.LoadInt64(&b.rateLimitedUntilNano)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func (b *Brake) setRateLimitedUntil(t time.Time) {
+	atomic.StoreInt64(&b.rateLimitedUntilNano, t.UnixNano())
+}
+
 func (b *Brake) humanLog(msg string) {
 	if !b.config.LogStdoutSilent {
 		io.WriteString(os.Stdout, msg)
@@ -154,16 +290,26 @@ func (b *Brake) humanLog(msg string) {
 	}
 }
 
-func (b *Brake) processNotice(not *notice) {
+func (b *Brake) processNotice(not *Notice) {
 	// setup notice
 	not.Notifier = Notifier
-	not.Context = b.context
+	if not.Severity == "" {
+		not.Severity = SeverityError
+	}
+	ctxCopy := *b.context
+	ctxCopy.Severity = not.Severity
+	not.Context = &ctxCopy
+
+	if b.config.MinSeverity != "" && severityRank[not.Severity] < severityRank[b.config.MinSeverity] {
+		// below the configured threshold
+		return
+	}
 
-	// create backtrace
-	//++ TODO: multi-thread (multi-goroutine) backtraces
-	//++ TODO: find out the limit of backtraces for a notify and limit to that
+	// create backtrace for the calling goroutine. Recovered panics get the
+	// other running goroutines' stacks attached too, see buildPanicNotice
+	// and appendGoroutineErrors in goroutines.go.
 	if not.Errors[0].Backtrace == nil {
-		not.Errors[0].Backtrace = make([]line, 0, 4)
+		not.Errors[0].Backtrace = make([]Line, 0, 4)
 	}
 
 	// get stack
@@ -190,13 +336,100 @@ func (b *Brake) processNotice(not *notice) {
 		}
 
 		// add line to backtrace
-		not.Errors[0].Backtrace = append(not.Errors[0].Backtrace, line{
+		not.Errors[0].Backtrace = append(not.Errors[0].Backtrace, Line{
 			File:     callerFile,
 			Line:     callerLine,
 			Function: funcName,
+			Code:     b.codeHunk(callerFile, callerLine),
 		})
 	}
 
+	if b.dedupe != nil && b.config.DedupeWindow > 0 {
+		send, closedCount := b.dedupe.observe(fingerprint(not), b.config.DedupeWindow)
+		if closedCount > 0 {
+			// a prior burst of duplicates just expired: report how many
+			// occurrences it contained as a single, separate notice
+			closing := *not
+			closing.Params = withOccurrences(not.Params, closedCount)
+			b.applyFiltersAndDispatch(&closing)
+		}
+		if !send {
+			// duplicate within the dedupe window, counted but not sent
+			return
+		}
+	}
+
+	b.applyFiltersAndDispatch(not)
+}
+
+// applyFiltersAndDispatch runs not through every registered Filter, in
+// order, and dispatches it unless a filter drops it by returning nil.
+func (b *Brake) applyFiltersAndDispatch(not *Notice) {
+	b.filtersMu.RLock()
+	filters := b.filters
+	b.filtersMu.RUnlock()
+
+	for _, filter := range filters {
+		not = filter(not)
+		if not == nil {
+			// a filter chose to ignore this notice
+			return
+		}
+	}
+
+	b.dispatchNotice(not)
+}
+
+// withOccurrences returns a copy of params with an "occurrences" key set,
+// used to report a burst of deduplicated notices as a single notice.
+func withOccurrences(params Vars, occurrences int) Vars {
+	merged := make(Vars, len(params)+1)
+	for k, v := range params {
+		merged[k] = v
+	}
+	merged["occurrences"] = occurrences
+	return merged
+}
+
+// dispatchNotice hands the notice off for delivery. When Config.Async is set
+// it is enqueued on the worker queue (dropping the oldest queued notice on
+// overflow); otherwise it is delivered synchronously on the calling goroutine.
+func (b *Brake) dispatchNotice(not *Notice) {
+	if !b.config.Async {
+		b.deliverNotice(not)
+		return
+	}
+
+	// closeMu is held for reading across the whole enqueue below, so Close
+	// can't close b.noticeCh underneath a concurrent send.
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		atomic.AddUint64(&b.NoticesDropped, 1)
+		return
+	}
+
+	b.pending.Add(1)
+	for {
+		select {
+		case b.noticeCh <- not:
+			return
+		default:
+			// queue is full: drop the oldest queued notice to make room and retry
+			select {
+			case <-b.noticeCh:
+				atomic.AddUint64(&b.NoticesDropped, 1)
+				b.pending.Done() // the dropped notice will never be delivered
+			default:
+			}
+		}
+	}
+}
+
+// deliverNotice sends the notice to the airbrake API and human-logs the
+// resulting (possibly shortened) URL. It is called synchronously or from a
+// worker goroutine, depending on Config.Async.
+func (b *Brake) deliverNotice(not *Notice) {
 	// get ns
 	ns, err := b.sendNotice(not)
 	if err != nil {
@@ -227,7 +460,14 @@ func (b *Brake) processNotice(not *notice) {
 	b.humanLog(fmt.Sprintf("error %s\n", url))
 }
 
-func (b *Brake) sendNotice(not *notice) (*noticeSuccess, error) {
+func (b *Brake) sendNotice(not *Notice) (*noticeSuccess, error) {
+	if atomic.LoadInt32(&b.unauthorized) != 0 {
+		return nil, ErrUnauthorized
+	}
+	if until := b.rateLimitedUntil(); !until.IsZero() && time.Now().Before(until) {
+		atomic.AddUint64(&b.NoticesRateLimited, 1)
+		return nil, ErrRateLimited
+	}
 
 	// write notice json to buffer
 	buf := bytes.NewBuffer(nil)
@@ -246,8 +486,8 @@ func (b *Brake) sendNotice(not *notice) (*noticeSuccess, error) {
 		return nil, fmt.Errorf("error making request to airbake service: %s\n", err)
 	}
 
-	// check response to have statuscode 201 created
-	if resp.StatusCode == 201 {
+	switch resp.StatusCode {
+	case 201:
 		ns := &noticeSuccess{}
 		defer resp.Body.Close()
 
@@ -260,18 +500,23 @@ func (b *Brake) sendNotice(not *notice) (*noticeSuccess, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error decoding response json: %s\n", err)
 		}
+		atomic.AddUint64(&b.NoticesSent, 1)
 		return ns, nil
-	}
 
-	return nil, fmt.Errorf("unexpected status from api: `%s`", resp.Status)
+	case 429:
+		defer resp.Body.Close()
+		b.setRateLimitedUntil(time.Now().Add(retryAfter(resp.Header.Get("Retry-After"))))
+		atomic.AddUint64(&b.NoticesRateLimited, 1)
+		return nil, ErrRateLimited
 
-	//++ TODO handle errors from API
-	// defer resp.Body.Close()
-	// p, _ := ioutil.ReadAll(resp.Body)
-	// os.Stdout.Write(p)
+	case 401, 403:
+		defer resp.Body.Close()
+		atomic.StoreInt32(&b.unauthorized, 1)
+		return nil, ErrUnauthorized
+	}
 
-	// // all done
-	// return nil, errors.New("didn't finish")
+	defer resp.Body.Close()
+	return nil, fmt.Errorf("unexpected status from api: `%s`", resp.Status)
 }
 
 type noticeSuccess struct {
@@ -293,9 +538,9 @@ type noticeSuccess struct {
 // example:
 // 	brake.Notify("EOF", "could not read from file")
 func (b *Brake) Notify(errorClass string, errorMessage string) {
-	n := &notice{
-		Errors: []*airError{
-			&airError{
+	n := &Notice{
+		Errors: []*Error{
+			&Error{
 				Type:    errorClass,
 				Message: errorMessage,
 			},
@@ -304,6 +549,25 @@ func (b *Brake) Notify(errorClass string, errorMessage string) {
 	b.processNotice(n)
 }
 
+// Error logs an error to the airbrake server
+// Error is an alias for Notify, kept for compatibility with code written
+// against earlier versions of this package.
+//
+// example:
+// 	brake.Error("EOF", "could not read from file")
+func (b *Brake) Error(errorClass string, errorMessage string) {
+	b.Notify(errorClass, errorMessage)
+}
+
+// Errorf logs an error to the airbrake server with a format/values error message
+// Errorf is an alias for Notifyf.
+//
+// example:
+// 	brake.Errorf("error", "could not read from file %s", filename)
+func (b *Brake) Errorf(errorClass string, format string, values ...interface{}) {
+	b.Notifyf(errorClass, format, values...)
+}
+
 // Notifyf logs an error to the airbrake server with a format/values error message
 // This is acutally just a shorthand for Error(errorClass, fmt.Sprintf("format %s %d", str, integer))
 //
@@ -325,10 +589,28 @@ func (b *Brake) Notifyf(errorClass string, format string, values ...interface{})
 //
 func (b *Brake) Recover() {
 	if r := recover(); r != nil {
-		b.Error("panic", fmt.Sprint(r))
+		b.processNotice(b.buildPanicNotice(r))
 	}
 }
 
+// buildPanicNotice builds the notice for a recovered panic: errors[0] is the
+// panic itself (its backtrace is filled in by processNotice, same as any
+// other notice), followed by one entry per other running goroutine, which
+// is invaluable for deadlock/race panics where the interesting stack is on
+// another goroutine.
+func (b *Brake) buildPanicNotice(r interface{}) *Notice {
+	not := &Notice{
+		Errors: []*Error{
+			&Error{
+				Type:    "panic",
+				Message: fmt.Sprint(r),
+			},
+		},
+	}
+	b.appendGoroutineErrors(not)
+	return not
+}
+
 // brakeHTTPHandler implements http.Handler
 // it wraps a http.Handler with brake panic recovery
 type brakeHTTPHandler struct {
@@ -337,13 +619,19 @@ type brakeHTTPHandler struct {
 }
 
 // ServeHTTP makes brakeHTTPHandler implement http.Handler
+// It scopes a RequestBrake to r, injects it into r's context so downstream
+// handlers can retrieve it with FromContext, and recovers panics into a
+// notice carrying the request's method, URL, headers and cookies.
 func (h brakeHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	defer h.brake.Recover()
+	rb := h.brake.WithRequest(r)
+	r = r.WithContext(WithRequestBrake(r.Context(), rb))
+	defer rb.Recover()
 	h.handler.ServeHTTP(w, r)
 }
 
 // WrapHTTPHandler wraps the given http.Handler with in a panic-recovering handler.
-// Any recovered panics are reported to airbrake
+// Any recovered panics are reported to airbrake, along with the request that
+// triggered them; see RequestBrake and FromContext.
 func (b *Brake) WrapHTTPHandler(handler http.Handler) http.Handler {
 	return brakeHTTPHandler{
 		brake:   b,
@@ -352,10 +640,13 @@ func (b *Brake) WrapHTTPHandler(handler http.Handler) http.Handler {
 }
 
 // WrapHTTPHandlerFunc wraps the given http.HandlerFunc in a panic-recovering handlerFunc.
-// Any recovered panics are reported to airbrake
+// Any recovered panics are reported to airbrake, along with the request that
+// triggered them; see RequestBrake and FromContext.
 func (b *Brake) WrapHTTPHandlerFunc(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		defer b.Recover()
+		rb := b.WithRequest(r)
+		r = r.WithContext(WithRequestBrake(r.Context(), rb))
+		defer rb.Recover()
 		handler(w, r)
 	}
 }
@@ -369,9 +660,9 @@ func (b *Brake) WrapHTTPHandlerFunc(handler http.HandlerFunc) http.HandlerFunc {
 // 	Params:      airbrake.Vars{"filename": "foo.bar", "object": airbrake.Vars{"foo": "bar", "number": 42}},
 // })
 func (b *Brake) NotifyData(errorClass string, errorMessage string, data Data) {
-	n := &notice{
-		Errors: []*airError{
-			&airError{
+	n := &Notice{
+		Errors: []*Error{
+			&Error{
 				Type:    errorClass,
 				Message: errorMessage,
 			},
@@ -383,22 +674,59 @@ func (b *Brake) NotifyData(errorClass string, errorMessage string, data Data) {
 	b.processNotice(n)
 }
 
+// NotifyWithSeverity logs an error to the airbrake server tagged with an
+// explicit Severity. Notices below Config.MinSeverity are dropped before
+// being sent.
+//
+// example:
+// 	brake.NotifyWithSeverity("EOF", "could not read from file", airbrake.SeverityWarning)
+func (b *Brake) NotifyWithSeverity(errorClass string, errorMessage string, sev Severity) {
+	n := &Notice{
+		Errors: []*Error{
+			&Error{
+				Type:    errorClass,
+				Message: errorMessage,
+			},
+		},
+		Severity: sev,
+	}
+	b.processNotice(n)
+}
+
+// ErrorData sends an error with data to airbrake
+// ErrorData is an alias for NotifyData.
+//
+// example:
+// brake.ErrorData("EOF", "could not read from file", airbrake.Data{
+// 	Environment: airbrake.Vars{"GOPATH": os.Getenv("GOPATH")},
+// 	Session:     airbrake.Vars{"AccountID": 1337},
+// 	Params:      airbrake.Vars{"filename": "foo.bar", "object": airbrake.Vars{"foo": "bar", "number": 42}},
+// })
+func (b *Brake) ErrorData(errorClass string, errorMessage string, data Data) {
+	b.NotifyData(errorClass, errorMessage, data)
+}
+
 const noticeVersion = "2.3"
 
-type notice struct {
+type Notice struct {
 	// Notifier (client library/package)
 	Notifier *notifier `json:"notifier"`
 
 	// Context
-	Context *context `json:"context"`
+	Context *noticeContext `json:"context"`
 
 	// Error
-	Errors []*airError `json:"errors"`
+	Errors []*Error `json:"errors"`
 
 	// Data fields
 	Environment Vars `json:"environment,omitempty"`
 	Session     Vars `json:"session,omitempty"`
 	Params      Vars `json:"params,omitempty"`
+
+	// Severity classifies this notice. Defaults to SeverityError and is
+	// copied onto Context.Severity by processNotice before sending. Not
+	// serialized directly; see Context.Severity.
+	Severity Severity `json:"-"`
 }
 
 // Data is to be used with Brake.ErrorData()
@@ -427,7 +755,7 @@ var Notifier = &notifier{
 	URL:     "https://github.com/GeertJohan/go.airbrake",
 }
 
-type context struct {
+type noticeContext struct {
 	OS            string `json:"os"`            // set by pkg (goos+goarch)
 	Language      string `json:"language"`      // set by pkg ("go" + version)
 	RootDirectory string `json:"rootDirectory"` // set by pkg (pwd)
@@ -439,23 +767,30 @@ type context struct {
 	UserID    string `json:"userId,omitempty"`    // set through config
 	UserName  string `json:"userName,omitempty"`  // set through config
 	UserEmail string `json:"userEmail,omitempty"` // set through config
+
+	Severity Severity `json:"severity,omitempty"` // set per-notice, see Notice.Severity
 }
 
-// airError contains the error information
-type airError struct {
+// Error contains the error information
+type Error struct {
 	// The type of error that occurred.
 	Type string `json:"type"`
 	// A short message describing the error that occurred.
 	Message string `json:"message,omitempty"`
 	// Stack trace
-	Backtrace []line `json:"backtrace,omitempty"`
+	Backtrace []Line `json:"backtrace,omitempty"`
 }
 
-// line from a stack trace
-type line struct {
+// Line is a single stack frame in a backtrace.
+type Line struct {
 	File     string `json:"file"`
 	Line     int    `json:"line"`
 	Function string `json:"function"`
+
+	// Code holds the source lines surrounding Line, keyed by line number.
+	// Nil when code hunk capture is disabled, the file could not be read, or
+	// it exceeds Config.CodeHunkCacheSize.
+	Code map[int]string `json:"code,omitempty"`
 }
 
 // Vars types a simple key/value map
@@ -0,0 +1,88 @@
+package airbrake
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultQueueSize is the capacity of the async notice queue used when
+// Config.Async is true and Config.QueueSize is left at zero.
+const DefaultQueueSize = 100
+
+// DefaultWorkers is the number of worker goroutines draining the async
+// notice queue when Config.Async is true and Config.Workers is left at zero.
+const DefaultWorkers = 4
+
+// startWorkers allocates the notice queue and spins up the configured
+// number of worker goroutines. Only called from NewBrake when Config.Async
+// is set.
+func (b *Brake) startWorkers() {
+	queueSize := b.config.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	workers := b.config.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	b.noticeCh = make(chan *Notice, queueSize)
+	for i := 0; i < workers; i++ {
+		b.workersWG.Add(1)
+		go b.worker()
+	}
+}
+
+// worker drains notices from the queue and delivers them until the queue is
+// closed.
+func (b *Brake) worker() {
+	defer b.workersWG.Done()
+	for not := range b.noticeCh {
+		b.deliverNotice(not)
+		b.pending.Done()
+	}
+}
+
+// Flush blocks until every notice queued (or already in flight) so far has
+// been delivered. Unlike Close, it does not stop the Brake from accepting
+// further notices. Flush is a no-op when Config.Async is false, since
+// Notify/Notifyf/NotifyData/Recover already deliver synchronously in that
+// mode.
+func (b *Brake) Flush() {
+	if !b.config.Async {
+		return
+	}
+	b.pending.Wait()
+}
+
+// Close stops the async queue from accepting new notices and waits for the
+// workers to drain it, or for ctx to be done, whichever happens first. Close
+// is a no-op when Config.Async is false. It is safe to call Close multiple
+// times, and safe to call concurrently with Notify/Notifyf/NotifyData/
+// Recover: notices racing the shutdown are dropped (counted in
+// NoticesDropped) rather than sent on a closed channel.
+func (b *Brake) Close(ctx context.Context) error {
+	if !b.config.Async {
+		return nil
+	}
+
+	b.closeMu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.noticeCh)
+	}
+	b.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.workersWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("airbrake: Close: %s", ctx.Err())
+	}
+}
@@ -0,0 +1,39 @@
+package airbrake
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCloseWhileDispatching exercises dispatchNotice (as called by
+// Notify/Recover) racing against Close, the scenario a graceful shutdown
+// hits when in-flight requests are still reporting notices. Before
+// dispatchNotice and Close coordinated over closeMu, this could panic with
+// "send on closed channel".
+func TestCloseWhileDispatching(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		b := NewBrake("project", "key", "test", &Config{Async: true, QueueSize: 1, LogStdoutSilent: true})
+		// point at an address nothing listens on, so sendNotice fails fast
+		// instead of making a real network call.
+		b.noticeURL = "http://127.0.0.1:1/notice"
+
+		var wg sync.WaitGroup
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.dispatchNotice(&Notice{Errors: []*Error{{Type: "RuntimeError", Message: "boom"}}})
+			}()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := b.Close(ctx); err != nil {
+			t.Errorf("Close: %s", err)
+		}
+		cancel()
+
+		wg.Wait()
+	}
+}
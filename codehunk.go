@@ -0,0 +1,158 @@
+package airbrake
+
+import (
+	"bufio"
+	"os"
+	"sync"
+)
+
+// DefaultCodeHunkLines is the number of lines of source captured before and
+// after a backtrace frame's line, when Config.CodeHunkLines is left at zero.
+const DefaultCodeHunkLines = 3
+
+// DefaultCodeHunkMaxFiles bounds how many distinct source files are kept in
+// the code hunk LRU cache, when Config.CodeHunkMaxFiles is left at zero.
+const DefaultCodeHunkMaxFiles = 64
+
+// DefaultCodeHunkCacheSize is the largest source file, in bytes, that will be
+// read for code hunk capture, when Config.CodeHunkCacheSize is left at zero.
+const DefaultCodeHunkCacheSize int64 = 512 * 1024
+
+// codeHunkKey identifies a cached, parsed source file by path and
+// modification time, so an edited file on disk isn't served from a stale
+// cache entry.
+type codeHunkKey struct {
+	path  string
+	mtime int64
+}
+
+// codeHunkCache is a small LRU cache of parsed source files, shared by every
+// frame of every notice processed by a Brake.
+type codeHunkCache struct {
+	mu       sync.Mutex
+	maxFiles int
+	order    []codeHunkKey
+	files    map[codeHunkKey]map[int]string
+}
+
+func newCodeHunkCache(maxFiles int) *codeHunkCache {
+	return &codeHunkCache{
+		maxFiles: maxFiles,
+		files:    make(map[codeHunkKey]map[int]string),
+	}
+}
+
+func (c *codeHunkCache) get(key codeHunkKey) (map[int]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines, ok := c.files[key]
+	if ok {
+		c.touch(key)
+	}
+	return lines, ok
+}
+
+func (c *codeHunkCache) put(key codeHunkKey, lines map[int]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.files[key]; exists {
+		c.touch(key)
+		c.files[key] = lines
+		return
+	}
+	if len(c.order) >= c.maxFiles {
+		delete(c.files, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.order = append(c.order, key)
+	c.files[key] = lines
+}
+
+// touch moves key to the most-recently-used end of c.order, so get/put
+// evict the least-recently-used file rather than just the oldest inserted
+// one.
+func (c *codeHunkCache) touch(key codeHunkKey) {
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, key)
+}
+
+// codeHunk returns the source lines surrounding line in file, padded by
+// Config.CodeHunkLines on either side. It returns nil when code hunk capture
+// is disabled, the file is missing, or it exceeds Config.CodeHunkCacheSize.
+func (b *Brake) codeHunk(file string, line int) map[int]string {
+	if b.codeHunks == nil {
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		// frame's file doesn't exist on this machine, e.g. stdlib on a
+		// machine without GOROOT sources
+		return nil
+	}
+
+	maxSize := b.config.CodeHunkCacheSize
+	if maxSize <= 0 {
+		maxSize = DefaultCodeHunkCacheSize
+	}
+	if info.Size() > maxSize {
+		return nil
+	}
+
+	contextLines := b.config.CodeHunkLines
+	if contextLines == 0 {
+		contextLines = DefaultCodeHunkLines
+	}
+
+	key := codeHunkKey{path: file, mtime: info.ModTime().UnixNano()}
+	lines, ok := b.codeHunks.get(key)
+	if !ok {
+		lines, err = readSourceLines(file)
+		if err != nil {
+			return nil
+		}
+		b.codeHunks.put(key, lines)
+	}
+
+	return codeHunkWindow(lines, line, contextLines)
+}
+
+// readSourceLines reads every line of file into a map keyed by its 1-based
+// line number.
+func readSourceLines(file string) (map[int]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make(map[int]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		lines[n] = scanner.Text()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// codeHunkWindow extracts the [line-context, line+context] window from a
+// parsed file's lines.
+func codeHunkWindow(lines map[int]string, line, context int) map[int]string {
+	hunk := make(map[int]string)
+	for n := line - context; n <= line+context; n++ {
+		if text, ok := lines[n]; ok {
+			hunk[n] = text
+		}
+	}
+	if len(hunk) == 0 {
+		return nil
+	}
+	return hunk
+}
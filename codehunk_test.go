@@ -0,0 +1,87 @@
+package airbrake
+
+import "testing"
+
+func sourceLines() map[int]string {
+	lines := make(map[int]string)
+	for n := 1; n <= 10; n++ {
+		lines[n] = "line"
+	}
+	return lines
+}
+
+func TestCodeHunkWindow(t *testing.T) {
+	hunk := codeHunkWindow(sourceLines(), 5, 2)
+	want := []int{3, 4, 5, 6, 7}
+	if len(hunk) != len(want) {
+		t.Fatalf("len(hunk) = %d, want %d", len(hunk), len(want))
+	}
+	for _, n := range want {
+		if _, ok := hunk[n]; !ok {
+			t.Errorf("hunk missing line %d", n)
+		}
+	}
+}
+
+func TestCodeHunkWindowClampsToFileBounds(t *testing.T) {
+	hunk := codeHunkWindow(sourceLines(), 1, 3)
+	for n := range hunk {
+		if n < 1 || n > 10 {
+			t.Errorf("hunk contains out-of-bounds line %d", n)
+		}
+	}
+	if _, ok := hunk[1]; !ok {
+		t.Errorf("hunk missing the requested line itself")
+	}
+}
+
+func TestCodeHunkWindowNoMatch(t *testing.T) {
+	if hunk := codeHunkWindow(sourceLines(), 100, 2); hunk != nil {
+		t.Errorf("codeHunkWindow() = %v, want nil for a line outside the file", hunk)
+	}
+}
+
+func TestCodeHunkCacheEvictsOldest(t *testing.T) {
+	c := newCodeHunkCache(2)
+
+	c.put(codeHunkKey{path: "a.go", mtime: 1}, map[int]string{1: "a"})
+	c.put(codeHunkKey{path: "b.go", mtime: 1}, map[int]string{1: "b"})
+	c.put(codeHunkKey{path: "c.go", mtime: 1}, map[int]string{1: "c"})
+
+	if _, ok := c.get(codeHunkKey{path: "a.go", mtime: 1}); ok {
+		t.Errorf("oldest entry should have been evicted")
+	}
+	if _, ok := c.get(codeHunkKey{path: "c.go", mtime: 1}); !ok {
+		t.Errorf("most recently put entry should still be cached")
+	}
+}
+
+func TestCodeHunkCacheGetKeepsEntryAlive(t *testing.T) {
+	c := newCodeHunkCache(2)
+	aKey := codeHunkKey{path: "a.go", mtime: 1}
+	bKey := codeHunkKey{path: "b.go", mtime: 1}
+
+	c.put(aKey, map[int]string{1: "a"})
+	c.put(bKey, map[int]string{1: "b"})
+
+	// touch a.go so it's the most recently used, then insert a third entry:
+	// b.go (not touched since its insert) should be evicted instead of a.go.
+	c.get(aKey)
+	c.put(codeHunkKey{path: "c.go", mtime: 1}, map[int]string{1: "c"})
+
+	if _, ok := c.get(aKey); !ok {
+		t.Errorf("recently touched entry should survive eviction")
+	}
+	if _, ok := c.get(bKey); ok {
+		t.Errorf("least-recently-used entry should have been evicted, not the touched one")
+	}
+}
+
+func TestCodeHunkCacheKeyedByMtime(t *testing.T) {
+	c := newCodeHunkCache(4)
+
+	c.put(codeHunkKey{path: "a.go", mtime: 1}, map[int]string{1: "old"})
+	if _, ok := c.get(codeHunkKey{path: "a.go", mtime: 2}); ok {
+		t.Errorf("a stale mtime should not hit the cache for a changed file")
+	}
+}
@@ -0,0 +1,94 @@
+package airbrake
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Filter inspects or modifies a notice before it is sent to airbrake.
+// Returning nil causes the notice to be dropped (ignored) entirely.
+// Register filters with Brake.AddFilter.
+type Filter func(*Notice) *Notice
+
+// sensitiveKeyPattern matches Vars keys that commonly hold secrets.
+var sensitiveKeyPattern = regexp.MustCompile(`(?i)password|token|secret|key|authorization`)
+
+// scrubbed is substituted for the value of any key matched by a scrubbing
+// filter.
+const scrubbed = "[FILTERED]"
+
+// KeyScrubFilter returns a Filter that replaces the value of any key
+// matching pattern in a notice's Params, Session and Environment with
+// "[FILTERED]". Use DefaultKeyScrubFilter for the common password/token/
+// secret/key/authorization pattern.
+func KeyScrubFilter(pattern *regexp.Regexp) Filter {
+	return func(not *Notice) *Notice {
+		scrubVars(not.Params, pattern)
+		scrubVars(not.Session, pattern)
+		scrubVars(not.Environment, pattern)
+		return not
+	}
+}
+
+// DefaultKeyScrubFilter is a KeyScrubFilter that scrubs keys matching
+// "password|token|secret|key|authorization" (case-insensitive).
+func DefaultKeyScrubFilter() Filter {
+	return KeyScrubFilter(sensitiveKeyPattern)
+}
+
+func scrubVars(vars Vars, pattern *regexp.Regexp) {
+	for key, value := range vars {
+		if pattern.MatchString(key) {
+			vars[key] = scrubbed
+			continue
+		}
+		scrubValue(value, pattern)
+	}
+}
+
+// scrubValue recurses into value if it is itself a Vars or
+// map[string]interface{}, so that keys nested under an unscrubbed parent
+// (e.g. Params["user"] = Vars{"password": ...}) are still scrubbed.
+func scrubValue(value interface{}, pattern *regexp.Regexp) {
+	switch nested := value.(type) {
+	case Vars:
+		scrubVars(nested, pattern)
+	case map[string]interface{}:
+		scrubVars(Vars(nested), pattern)
+	}
+}
+
+// TypeIgnoreFilter returns a Filter that drops any notice whose first
+// error's Type matches one of classes.
+func TypeIgnoreFilter(classes ...string) Filter {
+	return func(not *Notice) *Notice {
+		if len(not.Errors) == 0 {
+			return not
+		}
+		class := not.Errors[0].Type
+		for _, ignored := range classes {
+			if class == ignored {
+				return nil
+			}
+		}
+		return not
+	}
+}
+
+// FileIgnoreFilter returns a Filter that drops any notice whose topmost
+// backtrace frame originates from a file starting with one of prefixes.
+// Useful for suppressing errors raised from vendored or stdlib paths.
+func FileIgnoreFilter(prefixes ...string) Filter {
+	return func(not *Notice) *Notice {
+		if len(not.Errors) == 0 || len(not.Errors[0].Backtrace) == 0 {
+			return not
+		}
+		file := not.Errors[0].Backtrace[0].File
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(file, prefix) {
+				return nil
+			}
+		}
+		return not
+	}
+}
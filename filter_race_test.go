@@ -0,0 +1,33 @@
+package airbrake
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestAddFilterConcurrentWithDispatch exercises AddFilter racing against
+// applyFiltersAndDispatch (as called by Notify from many goroutines at
+// once), the scenario chunk0-1's async worker pool was built to support.
+// Before filtersMu, this could race on b.filters' slice header under
+// go test -race.
+func TestAddFilterConcurrentWithDispatch(t *testing.T) {
+	b := NewBrake("project", "key", "test", &Config{Async: true, QueueSize: 8, LogStdoutSilent: true})
+	b.noticeURL = "http://127.0.0.1:1/notice"
+
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.applyFiltersAndDispatch(&Notice{Errors: []*Error{{Type: "RuntimeError", Message: "boom"}}})
+		}()
+	}
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			b.AddFilter(TypeIgnoreFilter("Ignored"))
+		}(n)
+	}
+	wg.Wait()
+}
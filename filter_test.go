@@ -0,0 +1,131 @@
+package airbrake
+
+import "testing"
+
+func TestDefaultKeyScrubFilter(t *testing.T) {
+	filter := DefaultKeyScrubFilter()
+
+	cases := []struct {
+		name string
+		not  *Notice
+		want Vars
+	}{
+		{
+			name: "top-level match is scrubbed",
+			not:  &Notice{Params: Vars{"password": "hunter2", "username": "bob"}},
+			want: Vars{"password": scrubbed, "username": "bob"},
+		},
+		{
+			name: "match is case-insensitive",
+			not:  &Notice{Params: Vars{"API_KEY": "abc123"}},
+			want: Vars{"API_KEY": scrubbed},
+		},
+		{
+			name: "nested Vars is scrubbed",
+			not:  &Notice{Params: Vars{"user": Vars{"password": "hunter2", "name": "bob"}}},
+			want: Vars{"user": Vars{"password": scrubbed, "name": "bob"}},
+		},
+		{
+			name: "nested map[string]interface{} is scrubbed",
+			not:  &Notice{Params: Vars{"user": map[string]interface{}{"secret": "shh"}}},
+			want: Vars{"user": map[string]interface{}{"secret": scrubbed}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := filter(c.not)
+			if got == nil {
+				t.Fatal("filter dropped the notice, want it returned")
+			}
+			assertVarsEqual(t, got.Params, c.want)
+		})
+	}
+}
+
+func TestDefaultKeyScrubFilterScrubsSessionAndEnvironment(t *testing.T) {
+	filter := DefaultKeyScrubFilter()
+	not := &Notice{
+		Session:     Vars{"token": "abc"},
+		Environment: Vars{"secret": "xyz"},
+	}
+
+	got := filter(not)
+	assertVarsEqual(t, got.Session, Vars{"token": scrubbed})
+	assertVarsEqual(t, got.Environment, Vars{"secret": scrubbed})
+}
+
+func assertVarsEqual(t *testing.T, got, want Vars) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+	for k, wantVal := range want {
+		gotVal, ok := got[k]
+		if !ok {
+			t.Fatalf("missing key %q in %#v", k, got)
+		}
+		if wantNested, ok := wantVal.(Vars); ok {
+			gotNested, ok := gotVal.(Vars)
+			if !ok {
+				t.Fatalf("key %q: got %#v, want nested Vars", k, gotVal)
+			}
+			assertVarsEqual(t, gotNested, wantNested)
+			continue
+		}
+		if wantNested, ok := wantVal.(map[string]interface{}); ok {
+			gotNested, ok := gotVal.(map[string]interface{})
+			if !ok {
+				t.Fatalf("key %q: got %#v, want nested map", k, gotVal)
+			}
+			assertVarsEqual(t, Vars(gotNested), Vars(wantNested))
+			continue
+		}
+		if gotVal != wantVal {
+			t.Errorf("key %q: got %#v, want %#v", k, gotVal, wantVal)
+		}
+	}
+}
+
+func TestTypeIgnoreFilter(t *testing.T) {
+	filter := TypeIgnoreFilter("IgnoredError", "OtherError")
+
+	ignored := &Notice{Errors: []*Error{{Type: "IgnoredError"}}}
+	if filter(ignored) != nil {
+		t.Errorf("filter(%v) should drop a matching error type", ignored)
+	}
+
+	kept := &Notice{Errors: []*Error{{Type: "RealError"}}}
+	if filter(kept) == nil {
+		t.Errorf("filter(%v) should not drop a non-matching error type", kept)
+	}
+
+	noErrors := &Notice{}
+	if filter(noErrors) == nil {
+		t.Errorf("filter(%v) should pass through a notice with no errors", noErrors)
+	}
+}
+
+func TestFileIgnoreFilter(t *testing.T) {
+	filter := FileIgnoreFilter("/usr/local/go/src/", "/vendor/")
+
+	ignored := &Notice{Errors: []*Error{{Backtrace: []Line{{File: "/usr/local/go/src/runtime/panic.go"}}}}}
+	if filter(ignored) != nil {
+		t.Errorf("filter(%v) should drop a matching file prefix", ignored)
+	}
+
+	kept := &Notice{Errors: []*Error{{Backtrace: []Line{{File: "/home/user/app/main.go"}}}}}
+	if filter(kept) == nil {
+		t.Errorf("filter(%v) should not drop a non-matching file prefix", kept)
+	}
+
+	noBacktrace := &Notice{Errors: []*Error{{}}}
+	if filter(noBacktrace) == nil {
+		t.Errorf("filter(%v) should pass through a notice with no backtrace", noBacktrace)
+	}
+
+	noErrors := &Notice{}
+	if filter(noErrors) == nil {
+		t.Errorf("filter(%v) should pass through a notice with no errors", noErrors)
+	}
+}
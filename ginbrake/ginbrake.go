@@ -0,0 +1,34 @@
+// Package ginbrake integrates airbrake's request-scoped notices with gin.
+// It reports recovered panics tagged with the matched gin route template
+// instead of the raw URL, so Airbrake's route statistics feature can group
+// errors by endpoint.
+package ginbrake
+
+import (
+	"net/http"
+
+	"github.com/GeertJohan/go.airbrake"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns a gin middleware that scopes a RequestBrake to each
+// request, stores it in the request's context (retrievable with
+// airbrake.FromContext), and reports any recovered panic tagged with the
+// request and the matched route. Panics are reported through
+// RequestBrake.RecoverValue, so they carry the other running goroutines' stacks
+// the same way muxbrake and WrapHTTPHandler do.
+func Middleware(brake *airbrake.Brake) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rb := brake.WithRequest(c.Request).WithRoute(c.FullPath())
+		c.Request = c.Request.WithContext(airbrake.WithRequestBrake(c.Request.Context(), rb))
+
+		defer func() {
+			if r := recover(); r != nil {
+				rb.RecoverValue(r)
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+
+		c.Next()
+	}
+}
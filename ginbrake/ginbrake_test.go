@@ -0,0 +1,101 @@
+package ginbrake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GeertJohan/go.airbrake"
+	"github.com/gin-gonic/gin"
+)
+
+type notice struct {
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func newTestRouter(t *testing.T, got *notice, handler gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decoding posted notice: %s", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "url": "http://example.com/1"})
+	}))
+	t.Cleanup(server.Close)
+
+	brake := airbrake.NewBrake("project", "key", "test", &airbrake.Config{
+		LogStdoutSilent: true,
+		NoticeURL:       server.URL,
+	})
+
+	r := gin.New()
+	r.Use(Middleware(brake))
+	r.GET("/widgets/:id", handler)
+	return r
+}
+
+func TestMiddlewareReportsPanicAndAborts(t *testing.T) {
+	var got notice
+	r := newTestRouter(t, &got, func(c *gin.Context) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/:id", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if len(got.Errors) == 0 || got.Errors[0].Message != "boom" {
+		t.Fatalf("got.Errors = %+v, want a panic error with message %q", got.Errors, "boom")
+	}
+}
+
+func TestMiddlewarePassesThroughWithoutPanic(t *testing.T) {
+	var got notice
+	called := false
+	r := newTestRouter(t, &got, func(c *gin.Context) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/:id", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if !called {
+		t.Error("handler was not called")
+	}
+	if rec.Code == http.StatusInternalServerError {
+		t.Errorf("status = %d, want no abort for a non-panicking handler", rec.Code)
+	}
+	if len(got.Errors) != 0 {
+		t.Errorf("got.Errors = %+v, want no notice sent", got.Errors)
+	}
+}
+
+func TestMiddlewareStoresRequestBrakeInContext(t *testing.T) {
+	var got notice
+	r := newTestRouter(t, &got, func(c *gin.Context) {
+		rb, ok := airbrake.FromContext(c.Request.Context())
+		if !ok {
+			t.Error("FromContext did not find a RequestBrake")
+			return
+		}
+		rb.Notify("ManualError", "reported from handler")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/:id", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if len(got.Errors) == 0 || got.Errors[0].Type != "ManualError" {
+		t.Fatalf("got.Errors = %+v, want a ManualError notice", got.Errors)
+	}
+}
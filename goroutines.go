@@ -0,0 +1,153 @@
+package airbrake
+
+import (
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxGoroutines bounds how many other goroutines' stacks are
+// attached to a recovered panic's notice, when Config.MaxGoroutines is left
+// at zero.
+const DefaultMaxGoroutines = 10
+
+// DefaultMaxGoroutineFrames bounds how many backtrace frames are kept per
+// other goroutine, when Config.MaxGoroutineFrames is left at zero.
+const DefaultMaxGoroutineFrames = 20
+
+// goroutineHeaderPattern matches the "goroutine N [state]:" line that opens
+// each stack in a runtime.Stack(buf, true) dump.
+var goroutineHeaderPattern = regexp.MustCompile(`^goroutine (\d+) \[([^\]]+)\]:$`)
+
+// goroutineFramePattern matches the indented "file:line +0xNN" line that
+// follows a frame's function call line, including the one after a
+// "created by ..." caller line. The "+0xNN" offset is optional.
+var goroutineFramePattern = regexp.MustCompile(`^\t(.+):(\d+)(?: \+0x[0-9a-fA-F]+)?$`)
+
+// goroutineStack is one parsed "goroutine N [state]: ..." block.
+type goroutineStack struct {
+	id     int
+	state  string
+	frames []Line
+}
+
+// appendGoroutineErrors dumps every running goroutine's stack and appends
+// one *Error per goroutine other than the current one to not.Errors,
+// capped by Config.MaxGoroutines/Config.MaxGoroutineFrames. The current
+// goroutine is skipped since its backtrace is already built by
+// processNotice via runtime.Caller.
+func (b *Brake) appendGoroutineErrors(not *Notice) {
+	maxGoroutines := b.config.MaxGoroutines
+	if maxGoroutines <= 0 {
+		maxGoroutines = DefaultMaxGoroutines
+	}
+	maxFrames := b.config.MaxGoroutineFrames
+	if maxFrames <= 0 {
+		maxFrames = DefaultMaxGoroutineFrames
+	}
+
+	stacks := parseGoroutineDump(dumpAllGoroutines())
+	currentID := currentGoroutineID()
+
+	added := 0
+	for _, stack := range stacks {
+		if stack.id == currentID {
+			continue
+		}
+		if added >= maxGoroutines {
+			break
+		}
+
+		frames := stack.frames
+		if len(frames) > maxFrames {
+			frames = frames[:maxFrames]
+		}
+
+		not.Errors = append(not.Errors, &Error{
+			Type:      "panic:goroutine-" + strconv.Itoa(stack.id),
+			Message:   stack.state,
+			Backtrace: frames,
+		})
+		added++
+	}
+}
+
+// dumpAllGoroutines returns the text dump of every goroutine's stack, as
+// produced by runtime.Stack(buf, true).
+func dumpAllGoroutines() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// currentGoroutineID returns the id of the calling goroutine, by parsing the
+// header of its own (single-goroutine) stack dump.
+func currentGoroutineID() int {
+	buf := make([]byte, 128)
+	n := runtime.Stack(buf, false)
+	line := strings.SplitN(string(buf[:n]), "\n", 2)[0]
+	if m := goroutineHeaderPattern.FindStringSubmatch(line); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		return id
+	}
+	return -1
+}
+
+// parseGoroutineDump parses the text produced by runtime.Stack(buf, true)
+// into one goroutineStack per "goroutine N [state]:" block. It tolerates
+// inlined/generic frames and the "created by ..." caller line, since both
+// are just a function line followed by an indented "file:line" line.
+func parseGoroutineDump(dump []byte) []goroutineStack {
+	var stacks []goroutineStack
+	var current *goroutineStack
+	var pendingFunc string
+
+	flush := func() {
+		if current != nil {
+			stacks = append(stacks, *current)
+		}
+		current = nil
+		pendingFunc = ""
+	}
+
+	for _, line := range strings.Split(string(dump), "\n") {
+		if m := goroutineHeaderPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			id, _ := strconv.Atoi(m[1])
+			current = &goroutineStack{id: id, state: m[2]}
+			continue
+		}
+
+		if current == nil || line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "\t") {
+			if pendingFunc != "" {
+				if m := goroutineFramePattern.FindStringSubmatch(line); m != nil {
+					lineNo, _ := strconv.Atoi(m[2])
+					current.frames = append(current.frames, Line{
+						File:     m[1],
+						Line:     lineNo,
+						Function: pendingFunc,
+					})
+				}
+			}
+			pendingFunc = ""
+			continue
+		}
+
+		// a function call line: "pkg.Func(args)", an inlined/generic frame,
+		// or a "created by pkg.Func" caller annotation
+		pendingFunc = line
+	}
+	flush()
+
+	return stacks
+}
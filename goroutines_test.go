@@ -0,0 +1,62 @@
+package airbrake
+
+import "testing"
+
+const sampleGoroutineDump = `goroutine 1 [running]:
+main.main()
+	/home/user/main.go:10 +0x20
+
+goroutine 7 [chan receive]:
+main.worker(0xc000010018)
+	/home/user/worker.go:22 +0x45
+created by main.main
+	/home/user/main.go:8 +0x60
+`
+
+func TestParseGoroutineDump(t *testing.T) {
+	stacks := parseGoroutineDump([]byte(sampleGoroutineDump))
+	if len(stacks) != 2 {
+		t.Fatalf("len(stacks) = %d, want 2", len(stacks))
+	}
+
+	if stacks[0].id != 1 || stacks[0].state != "running" {
+		t.Errorf("stacks[0] = {id:%d state:%q}, want {id:1 state:\"running\"}", stacks[0].id, stacks[0].state)
+	}
+	if len(stacks[0].frames) != 1 || stacks[0].frames[0].File != "/home/user/main.go" || stacks[0].frames[0].Line != 10 {
+		t.Errorf("stacks[0].frames = %+v, want one frame at main.go:10", stacks[0].frames)
+	}
+
+	if stacks[1].id != 7 || stacks[1].state != "chan receive" {
+		t.Errorf("stacks[1] = {id:%d state:%q}, want {id:7 state:\"chan receive\"}", stacks[1].id, stacks[1].state)
+	}
+	if len(stacks[1].frames) != 2 {
+		t.Fatalf("len(stacks[1].frames) = %d, want 2 (the call frame and the created-by frame)", len(stacks[1].frames))
+	}
+	if stacks[1].frames[0].Function != "main.worker(0xc000010018)" || stacks[1].frames[0].Line != 22 {
+		t.Errorf("stacks[1].frames[0] = %+v, want main.worker at worker.go:22", stacks[1].frames[0])
+	}
+	if stacks[1].frames[1].Function != "created by main.main" || stacks[1].frames[1].Line != 8 {
+		t.Errorf("stacks[1].frames[1] = %+v, want created-by frame at main.go:8", stacks[1].frames[1])
+	}
+}
+
+func TestParseGoroutineDumpEmpty(t *testing.T) {
+	if stacks := parseGoroutineDump(nil); len(stacks) != 0 {
+		t.Errorf("parseGoroutineDump(nil) = %v, want empty", stacks)
+	}
+}
+
+func TestCurrentGoroutineIDFoundInDump(t *testing.T) {
+	id := currentGoroutineID()
+	if id <= 0 {
+		t.Fatalf("currentGoroutineID() = %d, want a positive id", id)
+	}
+
+	stacks := parseGoroutineDump(dumpAllGoroutines())
+	for _, s := range stacks {
+		if s.id == id {
+			return
+		}
+	}
+	t.Errorf("currentGoroutineID() = %d, not found in dumpAllGoroutines()", id)
+}
@@ -0,0 +1,227 @@
+package airbrake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestData holds the per-request information captured by Brake.WithRequest.
+type RequestData struct {
+	Method    string
+	URL       string
+	Route     string
+	RemoteIP  string
+	Referrer  string
+	UserAgent string
+	Query     Vars
+	Headers   Vars
+	Cookies   Vars
+}
+
+// RequestBrake is a Brake scoped to a single in-flight HTTP request. Notices
+// sent through it are automatically annotated with the request's method,
+// URL, headers (filtered) and cookies. Create one with Brake.WithRequest;
+// WrapHTTPHandler/WrapHTTPHandlerFunc do this for you and store the result
+// in the request's context, retrievable with FromContext.
+type RequestBrake struct {
+	*Brake
+	data RequestData
+}
+
+// requestHeaderBlacklist lists header names excluded from notice.Params,
+// since they commonly carry credentials.
+var requestHeaderBlacklist = map[string]bool{
+	"Cookie":        true,
+	"Authorization": true,
+}
+
+// WithRequest returns a RequestBrake scoped to r. Use it inside handlers
+// that don't go through WrapHTTPHandler/WrapHTTPHandlerFunc, e.g. framework
+// integrations like ginbrake and muxbrake.
+func (b *Brake) WithRequest(r *http.Request) *RequestBrake {
+	return &RequestBrake{
+		Brake: b,
+		data:  requestDataFromRequest(r),
+	}
+}
+
+// WithRoute returns a copy of rb annotated with the matched route pattern
+// (e.g. "/users/{id}"), so Airbrake's route statistics can group errors by
+// endpoint instead of by raw URL. Used by framework integrations that know
+// the matched route, like ginbrake and muxbrake.
+func (rb *RequestBrake) WithRoute(route string) *RequestBrake {
+	data := rb.data
+	data.Route = route
+	return &RequestBrake{Brake: rb.Brake, data: data}
+}
+
+// requestBrakeKey is the context.Context key WrapHTTPHandler stores the
+// RequestBrake under.
+type requestBrakeKey struct{}
+
+// WithRequestBrake returns a copy of ctx carrying rb, retrievable later with
+// FromContext. WrapHTTPHandler and WrapHTTPHandlerFunc call this for you;
+// framework integrations that build their own RequestBrake use it directly.
+func WithRequestBrake(ctx context.Context, rb *RequestBrake) context.Context {
+	return context.WithValue(ctx, requestBrakeKey{}, rb)
+}
+
+// FromContext returns the RequestBrake stored in ctx by WrapHTTPHandler (or
+// WithRequestBrake), and whether one was found.
+func FromContext(ctx context.Context) (*RequestBrake, bool) {
+	rb, ok := ctx.Value(requestBrakeKey{}).(*RequestBrake)
+	return rb, ok
+}
+
+// Notify logs an error to the airbrake server, annotated with the scoped
+// request's details.
+func (rb *RequestBrake) Notify(errorClass string, errorMessage string) {
+	rb.NotifyData(errorClass, errorMessage, Data{})
+}
+
+// Notifyf logs a formatted error to the airbrake server, annotated with the
+// scoped request's details.
+func (rb *RequestBrake) Notifyf(errorClass string, format string, values ...interface{}) {
+	rb.Notify(errorClass, fmt.Sprintf(format, values...))
+}
+
+// Error is an alias for Notify.
+func (rb *RequestBrake) Error(errorClass string, errorMessage string) {
+	rb.Notify(errorClass, errorMessage)
+}
+
+// Errorf is an alias for Notifyf.
+func (rb *RequestBrake) Errorf(errorClass string, format string, values ...interface{}) {
+	rb.Notifyf(errorClass, format, values...)
+}
+
+// NotifyData sends an error with data to airbrake, merging in the scoped
+// request's method, URL, route, filtered headers and cookies.
+func (rb *RequestBrake) NotifyData(errorClass string, errorMessage string, data Data) {
+	rb.Brake.NotifyData(errorClass, errorMessage, rb.mergeRequestData(data))
+}
+
+// ErrorData is an alias for NotifyData.
+func (rb *RequestBrake) ErrorData(errorClass string, errorMessage string, data Data) {
+	rb.NotifyData(errorClass, errorMessage, data)
+}
+
+// NotifyWithSeverity logs an error tagged with sev, annotated with the
+// scoped request's details; see Brake.NotifyWithSeverity.
+func (rb *RequestBrake) NotifyWithSeverity(errorClass string, errorMessage string, sev Severity) {
+	data := rb.mergeRequestData(Data{})
+	rb.Brake.processNotice(&Notice{
+		Errors:      []*Error{{Type: errorClass, Message: errorMessage}},
+		Environment: data.Environment,
+		Session:     data.Session,
+		Params:      data.Params,
+		Severity:    sev,
+	})
+}
+
+// Recover can be deferred to recover from a panic in a request handler. The
+// resulting notice carries the scoped request's details, plus the stacks of
+// any other running goroutines; see Brake.Recover.
+func (rb *RequestBrake) Recover() {
+	if r := recover(); r != nil {
+		rb.RecoverValue(r)
+	}
+}
+
+// RecoverValue reports r, the value returned by a prior call to the builtin
+// recover, the same way Recover does. Use it when the caller already called
+// recover itself, e.g. because it needs to take another action (such as
+// aborting the request) after reporting the panic; see ginbrake.Middleware.
+func (rb *RequestBrake) RecoverValue(r interface{}) {
+	not := rb.Brake.buildPanicNotice(r)
+	data := rb.mergeRequestData(Data{})
+	not.Environment = data.Environment
+	not.Params = data.Params
+	not.Session = data.Session
+	rb.Brake.processNotice(not)
+}
+
+// mergeRequestData merges rb's captured request details into data's
+// Environment, Params and Session.
+func (rb *RequestBrake) mergeRequestData(data Data) Data {
+	environment := make(Vars, len(data.Environment)+4)
+	for k, v := range data.Environment {
+		environment[k] = v
+	}
+	environment["httpMethod"] = rb.data.Method
+	environment["url"] = rb.data.URL
+	environment["userAgent"] = rb.data.UserAgent
+	if rb.data.Route != "" {
+		environment["route"] = rb.data.Route
+	}
+	if rb.data.Referrer != "" {
+		environment["referrer"] = rb.data.Referrer
+	}
+
+	params := make(Vars, len(data.Params)+len(rb.data.Query)+len(rb.data.Headers)+1)
+	for k, v := range data.Params {
+		params[k] = v
+	}
+	for k, v := range rb.data.Query {
+		params["query."+k] = v
+	}
+	for k, v := range rb.data.Headers {
+		params["header."+k] = v
+	}
+	params["remoteIP"] = rb.data.RemoteIP
+
+	session := make(Vars, len(data.Session)+len(rb.data.Cookies))
+	for k, v := range data.Session {
+		session[k] = v
+	}
+	for k, v := range rb.data.Cookies {
+		session[k] = v
+	}
+
+	return Data{
+		Environment: environment,
+		Params:      params,
+		Session:     session,
+	}
+}
+
+// requestDataFromRequest extracts RequestData from r, dropping headers in
+// requestHeaderBlacklist.
+func requestDataFromRequest(r *http.Request) RequestData {
+	headers := make(Vars, len(r.Header))
+	for name, values := range r.Header {
+		if requestHeaderBlacklist[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		headers[name] = strings.Join(values, "; ")
+	}
+
+	query := make(Vars)
+	for name, values := range r.URL.Query() {
+		query[name] = strings.Join(values, ", ")
+	}
+
+	cookies := make(Vars)
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
+		remoteIP = host
+	}
+
+	return RequestData{
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		RemoteIP:  remoteIP,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		Query:     query,
+		Headers:   headers,
+		Cookies:   cookies,
+	}
+}
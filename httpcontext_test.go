@@ -0,0 +1,118 @@
+package airbrake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeAirbrakeServer returns an httptest.Server that accepts any posted
+// notice, decodes it into *got, and replies as the real API does on success.
+func fakeAirbrakeServer(t *testing.T, got *Notice) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decoding posted notice: %s", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(noticeSuccess{ID: 1, URL: "http://example.com/1"})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestBrake(t *testing.T) (*Brake, *Notice) {
+	var got Notice
+	server := fakeAirbrakeServer(t, &got)
+	b := NewBrake("project", "key", "test", &Config{LogStdoutSilent: true})
+	b.noticeURL = server.URL
+	return b, &got
+}
+
+func TestWrapHTTPHandlerReportsPanicWithRequestDetails(t *testing.T) {
+	b, got := newTestBrake(t)
+
+	handler := b.WrapHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets?id=42", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Cookie", "session=secret-session")
+	req.Header.Set("X-Request-ID", "abc123")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if len(got.Errors) == 0 || got.Errors[0].Message != "boom" {
+		t.Fatalf("got.Errors = %+v, want a panic error with message %q", got.Errors, "boom")
+	}
+	if got.Params["header.Authorization"] != nil {
+		t.Errorf("Params[header.Authorization] = %v, want it scrubbed from the notice entirely", got.Params["header.Authorization"])
+	}
+	if got.Params["header.Cookie"] != nil {
+		t.Errorf("Params[header.Cookie] = %v, want it scrubbed from the notice entirely", got.Params["header.Cookie"])
+	}
+	if got.Params["header.X-Request-Id"] == nil && got.Params["header.X-Request-ID"] == nil {
+		t.Errorf("Params = %+v, want the non-blacklisted X-Request-ID header present", got.Params)
+	}
+	if got.Params["query.id"] != "42" {
+		t.Errorf("Params[query.id] = %v, want \"42\"", got.Params["query.id"])
+	}
+}
+
+func TestWrapHTTPHandlerFuncStoresRequestBrakeInContext(t *testing.T) {
+	b, got := newTestBrake(t)
+
+	handler := b.WrapHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rb, ok := FromContext(r.Context())
+		if !ok {
+			t.Fatal("FromContext did not find a RequestBrake")
+		}
+		rb.Notify("ManualError", "reported from handler")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if len(got.Errors) == 0 || got.Errors[0].Type != "ManualError" {
+		t.Fatalf("got.Errors = %+v, want a ManualError notice", got.Errors)
+	}
+}
+
+func TestRequestDataFromRequestDropsBlacklistedHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "a=b")
+	req.Header.Set("X-Custom", "keep-me")
+
+	data := requestDataFromRequest(req)
+
+	if _, ok := data.Headers["Authorization"]; ok {
+		t.Errorf("Headers = %+v, want Authorization dropped", data.Headers)
+	}
+	if _, ok := data.Headers["Cookie"]; ok {
+		t.Errorf("Headers = %+v, want Cookie dropped", data.Headers)
+	}
+	if data.Headers["X-Custom"] != "keep-me" {
+		t.Errorf("Headers[X-Custom] = %q, want %q", data.Headers["X-Custom"], "keep-me")
+	}
+}
+
+func TestWithRequestBrakeRoundTrip(t *testing.T) {
+	b := NewBrake("project", "key", "test", &Config{LogStdoutSilent: true})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rb := b.WithRequest(req)
+
+	ctx := WithRequestBrake(req.Context(), rb)
+	got, ok := FromContext(ctx)
+	if !ok || got != rb {
+		t.Errorf("FromContext(ctx) = (%v, %v), want (%v, true)", got, ok, rb)
+	}
+
+	if _, ok := FromContext(req.Context()); ok {
+		t.Errorf("FromContext should not find a RequestBrake in the original, un-decorated context")
+	}
+}
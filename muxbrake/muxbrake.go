@@ -0,0 +1,32 @@
+// Package muxbrake integrates airbrake's request-scoped notices with
+// gorilla/mux. It reports recovered panics tagged with the matched route
+// template instead of the raw URL, so Airbrake's route statistics feature
+// can group errors by endpoint.
+package muxbrake
+
+import (
+	"net/http"
+
+	"github.com/GeertJohan/go.airbrake"
+	"github.com/gorilla/mux"
+)
+
+// Wrap returns an http.Handler that scopes a RequestBrake to each request,
+// stores it in the request's context (retrievable with
+// airbrake.FromContext), and reports any recovered panic tagged with the
+// request and the matched mux route template. handler must be reached
+// through a mux.Router so mux.CurrentRoute can resolve the match.
+func Wrap(brake *airbrake.Brake, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rb := brake.WithRequest(r)
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				rb = rb.WithRoute(tmpl)
+			}
+		}
+		r = r.WithContext(airbrake.WithRequestBrake(r.Context(), rb))
+
+		defer rb.Recover()
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package muxbrake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GeertJohan/go.airbrake"
+	"github.com/gorilla/mux"
+)
+
+type notice struct {
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func newTestRouter(t *testing.T, got *notice, handler http.HandlerFunc) *mux.Router {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decoding posted notice: %s", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "url": "http://example.com/1"})
+	}))
+	t.Cleanup(server.Close)
+
+	brake := airbrake.NewBrake("project", "key", "test", &airbrake.Config{
+		LogStdoutSilent: true,
+		NoticeURL:       server.URL,
+	})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/widgets/{id}", Wrap(brake, handler).ServeHTTP)
+	return r
+}
+
+func TestWrapReportsPanic(t *testing.T) {
+	var got notice
+	r := newTestRouter(t, &got, func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/{id}", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if len(got.Errors) == 0 || got.Errors[0].Message != "boom" {
+		t.Fatalf("got.Errors = %+v, want a panic error with message %q", got.Errors, "boom")
+	}
+}
+
+func TestWrapPassesThroughWithoutPanic(t *testing.T) {
+	var got notice
+	called := false
+	r := newTestRouter(t, &got, func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/{id}", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if !called {
+		t.Error("handler was not called")
+	}
+	if len(got.Errors) != 0 {
+		t.Errorf("got.Errors = %+v, want no notice sent", got.Errors)
+	}
+}
+
+func TestWrapStoresRequestBrakeInContext(t *testing.T) {
+	var got notice
+	r := newTestRouter(t, &got, func(w http.ResponseWriter, req *http.Request) {
+		rb, ok := airbrake.FromContext(req.Context())
+		if !ok {
+			t.Error("FromContext did not find a RequestBrake")
+			return
+		}
+		rb.Notify("ManualError", "reported from handler")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/{id}", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if len(got.Errors) == 0 || got.Errors[0].Type != "ManualError" {
+		t.Fatalf("got.Errors = %+v, want a ManualError notice", got.Errors)
+	}
+}
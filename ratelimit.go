@@ -0,0 +1,43 @@
+package airbrake
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRateLimited is returned (and human-logged) when a notice could not be
+// sent because airbrake responded with, or is still within the back-off
+// window of, a 429 Too Many Requests.
+var ErrRateLimited = errors.New("airbrake: rate limited, try again later")
+
+// ErrUnauthorized is returned (and human-logged) when airbrake rejected the
+// project id or api key with a 401 or 403. This is sticky: no further
+// notices are posted until Brake.Reset is called.
+var ErrUnauthorized = errors.New("airbrake: unauthorized, check project id and api key")
+
+// defaultRetryAfter is used when airbrake sends a 429 without a Retry-After
+// header.
+const defaultRetryAfter = time.Minute
+
+// retryAfter parses the value of a Retry-After header, which per RFC 7231
+// is either a number of seconds or an HTTP-date. It falls back to
+// defaultRetryAfter when value is empty or unparseable.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+
+	return defaultRetryAfter
+}
@@ -0,0 +1,43 @@
+package airbrake
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", defaultRetryAfter},
+		{"seconds", "120", 120 * time.Second},
+		{"zero seconds", "0", 0},
+		{"garbage", "not-a-duration-or-date", defaultRetryAfter},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := retryAfter(c.value); got != c.want {
+				t.Errorf("retryAfter(%q) = %v, want %v", c.value, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(90 * time.Second).UTC()
+	got := retryAfter(future.Format(http.TimeFormat))
+	if got <= 0 || got > 90*time.Second {
+		t.Errorf("retryAfter(%q) = %v, want roughly 90s", future.Format(http.TimeFormat), got)
+	}
+}
+
+func TestRetryAfterPastHTTPDate(t *testing.T) {
+	past := time.Now().Add(-90 * time.Second).UTC()
+	if got := retryAfter(past.Format(http.TimeFormat)); got != defaultRetryAfter {
+		t.Errorf("retryAfter(%q) = %v, want defaultRetryAfter for a past date", past.Format(http.TimeFormat), got)
+	}
+}
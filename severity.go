@@ -0,0 +1,175 @@
+package airbrake
+
+import (
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+// Severity classifies how serious a notice is. It is serialized into the
+// notice's context.severity field per the Airbrake v3 notice schema.
+type Severity string
+
+// Severity levels, ordered from least to most severe.
+const (
+	SeverityDebug     Severity = "debug"
+	SeverityInfo      Severity = "info"
+	SeverityNotice    Severity = "notice"
+	SeverityWarning   Severity = "warning"
+	SeverityError     Severity = "error"
+	SeverityCritical  Severity = "critical"
+	SeverityAlert     Severity = "alert"
+	SeverityEmergency Severity = "emergency"
+)
+
+// severityRank orders severities for Config.MinSeverity comparisons.
+var severityRank = map[Severity]int{
+	SeverityDebug:     0,
+	SeverityInfo:      1,
+	SeverityNotice:    2,
+	SeverityWarning:   3,
+	SeverityError:     4,
+	SeverityCritical:  5,
+	SeverityAlert:     6,
+	SeverityEmergency: 7,
+}
+
+// DefaultDedupeCacheSize bounds how many distinct fingerprints are kept in
+// the deduplication LRU.
+const DefaultDedupeCacheSize = 1024
+
+// fingerprint computes an FNV-64a hash of the error class and the
+// function+file of the first three backtrace frames, used to recognize
+// repeated errors for deduplication.
+func fingerprint(not *Notice) uint64 {
+	h := fnv.New64a()
+	if len(not.Errors) > 0 {
+		io.WriteString(h, not.Errors[0].Type)
+
+		frames := not.Errors[0].Backtrace
+		if len(frames) > 3 {
+			frames = frames[:3]
+		}
+		for _, frame := range frames {
+			io.WriteString(h, frame.Function)
+			io.WriteString(h, frame.File)
+		}
+	}
+	return h.Sum64()
+}
+
+// dedupeEntry tracks a fingerprint's current burst of occurrences.
+type dedupeEntry struct {
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// dedupeCache is a small LRU of fingerprint -> dedupeEntry, shared by every
+// notice processed by a Brake.
+type dedupeCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      []uint64
+	entries    map[uint64]*dedupeEntry
+}
+
+func newDedupeCache(maxEntries int) *dedupeCache {
+	return &dedupeCache{
+		maxEntries: maxEntries,
+		entries:    make(map[uint64]*dedupeEntry),
+	}
+}
+
+// observe records an occurrence of fp and decides whether it should be sent.
+//
+// send is true when this occurrence starts a fresh burst (the fingerprint
+// hasn't been seen, or the previous occurrence was outside window) and
+// should be delivered as-is. When a fresh burst follows one that contained
+// more than one occurrence, closedCount carries the size of that just-ended
+// burst, so the caller can report it as a single notice with an
+// "occurrences" param. Occurrences observed mid-burst (within window of the
+// last one) are counted but not sent (send is false).
+func (c *dedupeCache) observe(fp uint64, window time.Duration) (send bool, closedCount int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	e, ok := c.entries[fp]
+	if !ok {
+		c.put(fp, &dedupeEntry{count: 1, firstSeen: now, lastSeen: now})
+		return true, 0
+	}
+	c.touch(fp)
+
+	if now.Sub(e.lastSeen) > window {
+		closed := e.count
+		e.count = 1
+		e.firstSeen = now
+		e.lastSeen = now
+		if closed > 1 {
+			return true, closed
+		}
+		return true, 0
+	}
+
+	e.count++
+	e.lastSeen = now
+	return false, 0
+}
+
+func (c *dedupeCache) put(fp uint64, e *dedupeEntry) {
+	if _, exists := c.entries[fp]; !exists {
+		if len(c.order) >= c.maxEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, fp)
+	}
+	c.entries[fp] = e
+}
+
+// touch moves fp to the most-recently-used end of c.order, so observe
+// evicts the least-recently-observed fingerprint rather than just the
+// oldest inserted one.
+func (c *dedupeCache) touch(fp uint64) {
+	for i, k := range c.order {
+		if k == fp {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, fp)
+}
+
+// DedupeStat summarizes one fingerprint's currently tracked burst of
+// occurrences, as returned by Brake.Stats.
+type DedupeStat struct {
+	Fingerprint uint64
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// Stats returns a snapshot of the deduplication LRU, for metrics scraping.
+// Empty when Config.DedupeWindow is 0.
+func (b *Brake) Stats() []DedupeStat {
+	if b.dedupe == nil {
+		return nil
+	}
+
+	b.dedupe.mu.Lock()
+	defer b.dedupe.mu.Unlock()
+
+	stats := make([]DedupeStat, 0, len(b.dedupe.entries))
+	for fp, e := range b.dedupe.entries {
+		stats = append(stats, DedupeStat{
+			Fingerprint: fp,
+			Count:       e.count,
+			FirstSeen:   e.firstSeen,
+			LastSeen:    e.lastSeen,
+		})
+	}
+	return stats
+}
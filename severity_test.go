@@ -0,0 +1,98 @@
+package airbrake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintSameErrorSameFingerprint(t *testing.T) {
+	a := &Notice{Errors: []*Error{{
+		Type:      "RuntimeError",
+		Backtrace: []Line{{Function: "main.foo", File: "main.go"}, {Function: "main.main", File: "main.go"}},
+	}}}
+	b := &Notice{Errors: []*Error{{
+		Type:      "RuntimeError",
+		Backtrace: []Line{{Function: "main.foo", File: "main.go"}, {Function: "main.main", File: "main.go"}},
+	}}}
+
+	if fingerprint(a) != fingerprint(b) {
+		t.Errorf("fingerprint differed for identical errors")
+	}
+}
+
+func TestFingerprintDifferentErrorClassDifferentFingerprint(t *testing.T) {
+	a := &Notice{Errors: []*Error{{Type: "RuntimeError"}}}
+	b := &Notice{Errors: []*Error{{Type: "TypeError"}}}
+
+	if fingerprint(a) == fingerprint(b) {
+		t.Errorf("fingerprint matched for different error classes")
+	}
+}
+
+func TestFingerprintOnlyConsidersFirstThreeFrames(t *testing.T) {
+	deepBacktrace := []Line{
+		{Function: "main.a", File: "main.go"},
+		{Function: "main.b", File: "main.go"},
+		{Function: "main.c", File: "main.go"},
+		{Function: "main.d", File: "main.go"},
+	}
+	a := &Notice{Errors: []*Error{{Type: "RuntimeError", Backtrace: deepBacktrace}}}
+	b := &Notice{Errors: []*Error{{Type: "RuntimeError", Backtrace: append(append([]Line{}, deepBacktrace[:3]...), Line{Function: "main.other", File: "other.go"})}}}
+
+	if fingerprint(a) != fingerprint(b) {
+		t.Errorf("fingerprint should only depend on the first three frames")
+	}
+}
+
+func TestDedupeCacheObserve(t *testing.T) {
+	c := newDedupeCache(DefaultDedupeCacheSize)
+
+	send, closed := c.observe(1, time.Hour)
+	if !send || closed != 0 {
+		t.Fatalf("first occurrence: send=%v closed=%d, want true/0", send, closed)
+	}
+
+	send, closed = c.observe(1, time.Hour)
+	if send || closed != 0 {
+		t.Fatalf("mid-burst duplicate: send=%v closed=%d, want false/0", send, closed)
+	}
+
+	send, closed = c.observe(1, 0)
+	if !send || closed != 2 {
+		t.Fatalf("burst rollover: send=%v closed=%d, want true/2", send, closed)
+	}
+}
+
+func TestDedupeCacheObserveKeepsFingerprintAlive(t *testing.T) {
+	c := newDedupeCache(2)
+
+	c.observe(1, time.Hour)
+	c.observe(2, time.Hour)
+
+	// re-observe fingerprint 1 so it's the most recently used, then observe
+	// a third fingerprint: 2 (not re-observed) should be evicted instead.
+	c.observe(1, time.Hour)
+	c.observe(3, time.Hour)
+
+	if _, ok := c.entries[1]; !ok {
+		t.Errorf("recently re-observed fingerprint should survive eviction")
+	}
+	if _, ok := c.entries[2]; ok {
+		t.Errorf("least-recently-observed fingerprint should have been evicted, not the re-observed one")
+	}
+}
+
+func TestDedupeCacheEvictsOldest(t *testing.T) {
+	c := newDedupeCache(2)
+
+	c.observe(1, time.Hour)
+	c.observe(2, time.Hour)
+	c.observe(3, time.Hour)
+
+	if _, ok := c.entries[1]; ok {
+		t.Errorf("oldest fingerprint should have been evicted")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("len(entries) = %d, want 2", len(c.entries))
+	}
+}